@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+)
+
+func TestXoauth2ClientStart(t *testing.T) {
+	c := newXoauth2Client("user@example.com", "token123")
+
+	mech, ir, err := c.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if mech != "XOAUTH2" {
+		t.Errorf("mech = %q, want XOAUTH2", mech)
+	}
+
+	want := "user=user@example.com\x01auth=Bearer token123\x01\x01"
+	if string(ir) != want {
+		t.Errorf("initial response = %q, want %q", ir, want)
+	}
+}
+
+func TestXoauth2ClientNextRejectsChallenge(t *testing.T) {
+	c := newXoauth2Client("user@example.com", "token123")
+	if _, err := c.Next([]byte("anything")); err == nil {
+		t.Error("Next: expected error on unexpected server challenge, got nil")
+	}
+}
+
+func TestCramMD5ClientStart(t *testing.T) {
+	c := newCramMD5Client("user", "pass")
+
+	mech, ir, err := c.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if mech != "CRAM-MD5" {
+		t.Errorf("mech = %q, want CRAM-MD5", mech)
+	}
+	if ir != nil {
+		t.Errorf("initial response = %q, want nil (CRAM-MD5 has none)", ir)
+	}
+}
+
+func TestCramMD5ClientNext(t *testing.T) {
+	username, password := "user", "pass"
+	challenge := []byte("<1896.697170952@postoffice.example.net>")
+
+	c := newCramMD5Client(username, password)
+	resp, err := c.Next(challenge)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+
+	mac := hmac.New(md5.New, []byte(password))
+	mac.Write(challenge)
+	want := username + " " + hex.EncodeToString(mac.Sum(nil))
+
+	if string(resp) != want {
+		t.Errorf("response = %q, want %q", resp, want)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/emersion/go-sasl"
+	"gopkg.in/yaml.v2"
+)
+
+// TLSConfig describes the TLS behaviour for a single target. TLS is on by
+// default and verification is never relaxed unless explicitly requested.
+type TLSConfig struct {
+	// STARTTLS selects STARTTLS negotiation on a plaintext connection
+	// instead of implicit TLS (the default).
+	STARTTLS bool `yaml:"starttls"`
+
+	ServerName         string `yaml:"server_name"`
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+func (t TLSConfig) tlsConfig(fallbackServerName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = fallbackServerName
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file %q", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// AuthConfig selects the SASL mechanism used to authenticate against the
+// IMAP server and carries whatever credentials that mechanism needs.
+// go-sasl only provides PLAIN, LOGIN, ANONYMOUS, EXTERNAL and OAUTHBEARER
+// clients, so xoauth2 and cram-md5 are implemented by hand in auth.go.
+type AuthConfig struct {
+	// Mechanism is one of "login" (default), "plain", "xoauth2" or
+	// "cram-md5".
+	Mechanism string `yaml:"mechanism"`
+
+	// Identity is used by PLAIN as the authorization identity. It is
+	// usually left empty.
+	Identity string `yaml:"identity"`
+
+	// Token is the bearer token used by XOAUTH2.
+	Token string `yaml:"token"`
+}
+
+func (a AuthConfig) saslClient(username, password string) (sasl.Client, error) {
+	switch a.Mechanism {
+	case "", "login":
+		return nil, nil
+	case "plain":
+		return sasl.NewPlainClient(a.Identity, username, password), nil
+	case "xoauth2":
+		return newXoauth2Client(username, a.Token), nil
+	case "cram-md5":
+		return newCramMD5Client(username, password), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth mechanism %q", a.Mechanism)
+	}
+}
+
+// SearchQueryConfig names an IMAP SEARCH query whose result count is
+// exposed as imap_search_results{query="Name"}. Criteria uses a small
+// subset of IMAP search syntax, see parseSearchCriteria.
+type SearchQueryConfig struct {
+	Name     string `yaml:"name"`
+	Criteria string `yaml:"criteria"`
+}
+
+// TargetConfig is a single IMAP mailbox to be scraped, belonging to an
+// Account. Its metrics are labeled with the owning account's name.
+type TargetConfig struct {
+	Mailbox  string              `yaml:"mailbox"`
+	Searches []SearchQueryConfig `yaml:"searches"`
+
+	// Notify, when set, requires Persistent on the owning account: new
+	// messages are only detected via the IDLE-driven session, not
+	// stateless per-scrape queries.
+	Notify *NotifyConfig `yaml:"notify"`
+}
+
+// AccountConfig describes one IMAP account: where to connect, how to
+// authenticate, and which mailboxes to expose metrics for.
+type AccountConfig struct {
+	Name     string `yaml:"name"`
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	TLS        TLSConfig  `yaml:"tls"`
+	Auth       AuthConfig `yaml:"auth"`
+	Quota      bool       `yaml:"quota"`
+	Persistent bool       `yaml:"persistent"`
+
+	Mailboxes []TargetConfig `yaml:"mailboxes"`
+}
+
+// ModuleConfig binds credentials, TLS and auth settings under a name that
+// can be referenced from the /probe endpoint, mirroring the blackbox
+// exporter's notion of a "module". Unlike AccountConfig it carries no
+// server or mailbox list: those come from the probe request itself.
+type ModuleConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	TLS   TLSConfig  `yaml:"tls"`
+	Auth  AuthConfig `yaml:"auth"`
+	Quota bool       `yaml:"quota"`
+
+	Searches []SearchQueryConfig `yaml:"searches"`
+}
+
+// Config is the top level exporter configuration, holding every account to
+// be scraped by this process plus the named modules available to /probe.
+type Config struct {
+	Accounts []AccountConfig         `yaml:"accounts"`
+	Modules  map[string]ModuleConfig `yaml:"modules"`
+}
+
+// LoadConfig reads and validates a YAML configuration file describing one
+// or more IMAP accounts and mailboxes.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+
+	if len(cfg.Accounts) == 0 {
+		return nil, fmt.Errorf("config must declare at least one account")
+	}
+	for i, acc := range cfg.Accounts {
+		if acc.Server == "" {
+			return nil, fmt.Errorf("accounts[%d]: server is required", i)
+		}
+		if acc.Username == "" {
+			return nil, fmt.Errorf("accounts[%d]: username is required", i)
+		}
+		if acc.Name == "" {
+			cfg.Accounts[i].Name = acc.Username
+		}
+		if len(acc.Mailboxes) == 0 {
+			cfg.Accounts[i].Mailboxes = []TargetConfig{{Mailbox: "INBOX"}}
+		}
+	}
+
+	return &cfg, nil
+}
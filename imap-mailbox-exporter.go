@@ -1,10 +1,12 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"flag"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
@@ -13,60 +15,197 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// exporterLog is the package-scoped logger for this file; every entry it
+// produces carries pkg="exporter" so log-based alerts can filter on it.
+var exporterLog = logrus.WithField("pkg", "exporter")
+
 type ImapState struct {
 	messagesCount float64
+	unseenCount   float64
+	recentCount   float64
+	uidNext       float64
+	uidValidity   float64
 	up            int
+
+	searchResults map[string]float64
+	quota         *quotaResult
+
+	loginDuration  time.Duration
+	selectDuration time.Duration
+}
+
+// contextDialer lets a context.Context deadline bound the TCP dial made by
+// go-imap's client.DialWithDialer, since the client predates context-aware
+// dialing. The deadline is not set on the returned net.Conn, so commands
+// sent after the dial are not bounded by it.
+type contextDialer struct {
+	ctx context.Context
 }
 
+func (d contextDialer) Dial(network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(d.ctx, network, address)
+}
+
+// Exporter scrapes a single (account, mailbox) target and exposes it as
+// Prometheus metrics.
 type Exporter struct {
-	mailserver string
+	account    string
+	server     string
 	username   string
 	password   string
 	mailbox    string
+	tls        TLSConfig
+	auth       AuthConfig
+	quota      bool
+	searches   []SearchQueryConfig
+	persistent bool
+	notify     *NotifyConfig
+
+	up                *prometheus.Desc
+	messagesCount     prometheus.Gauge
+	unseenCount       *prometheus.Desc
+	recentCount       *prometheus.Desc
+	uidNext           *prometheus.Desc
+	uidValidity       *prometheus.Desc
+	searchResults     *prometheus.Desc
+	quotaUsedBytes    *prometheus.Desc
+	quotaLimitBytes   *prometheus.Desc
+	quotaUsedMessages *prometheus.Desc
+	lastError         *prometheus.CounterVec
+}
 
-	up            *prometheus.Desc
-	messagesCount prometheus.Gauge
+// logger returns a logrus entry pre-populated with this target's identity,
+// so every log line it produces can be correlated with its imap_up and
+// imap_last_error series.
+func (exp *Exporter) logger() *logrus.Entry {
+	return exporterLog.WithFields(logrus.Fields{
+		"account": exp.account,
+		"server":  exp.server,
+		"mailbox": exp.mailbox,
+	})
 }
 
-func NewExporter(mailserver, username, password string, mailbox string) *Exporter {
+// NewExporter builds an Exporter for a single mailbox belonging to acc.
+func NewExporter(acc AccountConfig, target TargetConfig) *Exporter {
+	labels := map[string]string{
+		"account": acc.Name,
+		"server":  acc.Server,
+		"mailbox": target.Mailbox,
+	}
+
 	return &Exporter{
-		mailserver: mailserver,
-		username:   username,
-		password:   password,
-		mailbox:    mailbox,
+		account:    acc.Name,
+		server:     acc.Server,
+		username:   acc.Username,
+		password:   acc.Password,
+		mailbox:    target.Mailbox,
+		tls:        acc.TLS,
+		auth:       acc.Auth,
+		quota:      acc.Quota,
+		searches:   target.Searches,
+		persistent: acc.Persistent,
+		notify:     target.Notify,
 
 		up: prometheus.NewDesc(
 			prometheus.BuildFQName("imap", "", "up"),
 			"IMAP server is accessible and up",
 			nil,
-			map[string]string{
-				"mailbox":  mailbox,
-				"username": username,
-			}),
+			labels),
 		messagesCount: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: "imap",
-			Name:      "messages",
-			Help:      "Current number of messages in mailbox",
-			ConstLabels: map[string]string{
-				"mailbox":  mailbox,
-				"username": username,
-			},
+			Namespace:   "imap",
+			Name:        "messages",
+			Help:        "Current number of messages in mailbox",
+			ConstLabels: labels,
 		}),
+		unseenCount: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "messages", "unseen"),
+			"Number of messages without the \\Seen flag",
+			nil, labels),
+		recentCount: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "messages", "recent"),
+			"Number of messages with the \\Recent flag",
+			nil, labels),
+		uidNext: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "", "uidnext"),
+			"Predicted UID of the next message to arrive",
+			nil, labels),
+		uidValidity: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "", "uidvalidity"),
+			"UID validity value of the mailbox",
+			nil, labels),
+		searchResults: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "search", "results"),
+			"Number of messages matching a configured search query",
+			[]string{"query"}, labels),
+		quotaUsedBytes: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "quota", "used_bytes"),
+			"STORAGE quota usage reported by the IMAP server (RFC 2087)",
+			nil, labels),
+		quotaLimitBytes: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "quota", "limit_bytes"),
+			"STORAGE quota limit reported by the IMAP server (RFC 2087)",
+			nil, labels),
+		quotaUsedMessages: prometheus.NewDesc(
+			prometheus.BuildFQName("imap", "quota", "used_messages"),
+			"MESSAGE quota usage reported by the IMAP server (RFC 2087)",
+			nil, labels),
+		lastError: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "imap",
+			Name:        "last_error",
+			Help:        "Count of errors encountered per IMAP session stage",
+			ConstLabels: labels,
+		}, []string{"stage"}),
 	}
 }
 
 func (exp *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- exp.up
 	ch <- exp.messagesCount.Desc()
+	ch <- exp.unseenCount
+	ch <- exp.recentCount
+	ch <- exp.uidNext
+	ch <- exp.uidValidity
+	ch <- exp.searchResults
+	ch <- exp.quotaUsedBytes
+	ch <- exp.quotaLimitBytes
+	ch <- exp.quotaUsedMessages
+	exp.lastError.Describe(ch)
 }
 
-func (exp *Exporter) queryImapServer() ImapState {
+func (exp *Exporter) dial(ctx context.Context) (*client.Client, error) {
+	tlsConfig, err := exp.tls.tlsConfig(exp.server)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := contextDialer{ctx: ctx}
+
+	if exp.tls.STARTTLS {
+		imapClient, err := client.DialWithDialer(dialer, exp.server)
+		if err != nil {
+			return nil, err
+		}
+		if err := imapClient.StartTLS(tlsConfig); err != nil {
+			imapClient.Logout()
+			return nil, err
+		}
+		return imapClient, nil
+	}
+
+	return client.DialWithDialerTLS(dialer, exp.server, tlsConfig)
+}
+
+// queryImapServer runs a full dial/login/select cycle against the target
+// and returns the resulting state, honouring ctx's deadline for the dial.
+func (exp *Exporter) queryImapServer(ctx context.Context) ImapState {
 	state := ImapState{}
 
 	// Connect to the server
-	imapClient, err := client.DialTLS(exp.mailserver, &tls.Config{InsecureSkipVerify: true})
+	imapClient, err := exp.dial(ctx)
 	if err != nil {
-		logrus.Error(err)
+		exp.lastError.WithLabelValues("dial").Inc()
+		exp.logger().WithField("stage", "dial").Error(err)
 		return state
 	}
 
@@ -75,36 +214,125 @@ func (exp *Exporter) queryImapServer() ImapState {
 
 	// Authenticate
 	if imapClient.State() != imap.NotAuthenticatedState {
-		logrus.Error("IMAP server in wrong state for Login!")
+		exp.logger().WithFields(logrus.Fields{
+			"stage":      "login",
+			"imap_state": imapClient.State(),
+		}).Error("IMAP server in wrong state for Login!")
 		return ImapState{}
 	}
-	err = imapClient.Login(exp.username, exp.password)
+
+	saslClient, err := exp.auth.saslClient(exp.username, exp.password)
 	if err != nil {
-		logrus.Error(err)
+		exp.logger().WithField("stage", "login").Error(err)
+		return ImapState{}
+	}
+
+	loginStart := time.Now()
+	if saslClient != nil {
+		err = imapClient.Authenticate(saslClient)
+	} else {
+		err = imapClient.Login(exp.username, exp.password)
+	}
+	state.loginDuration = time.Since(loginStart)
+	if err != nil {
+		exp.lastError.WithLabelValues("login").Inc()
+		exp.logger().WithFields(logrus.Fields{
+			"stage":       "login",
+			"duration_ms": state.loginDuration.Milliseconds(),
+		}).Error(err)
 		return ImapState{}
 	}
 
 	// Open a mailbox read-only (synchronous command - no need for imap.Wait)
+	selectStart := time.Now()
 	status, err := imapClient.Select(exp.mailbox, true)
+	state.selectDuration = time.Since(selectStart)
 	if err != nil {
-		logrus.Error(err)
+		exp.lastError.WithLabelValues("select").Inc()
+		exp.logger().WithFields(logrus.Fields{
+			"stage":       "select",
+			"duration_ms": state.selectDuration.Milliseconds(),
+		}).Error(err)
 		return ImapState{}
 	}
 
 	state.up = 1
 	state.messagesCount = float64(status.Messages)
+	state.recentCount = float64(status.Recent)
+	state.uidNext = float64(status.UidNext)
+	state.uidValidity = float64(status.UidValidity)
+
+	unseen, err := imapClient.Search(&imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}})
+	if err != nil {
+		exp.logger().Error(err)
+	} else {
+		state.unseenCount = float64(len(unseen))
+	}
+
+	state.searchResults = make(map[string]float64, len(exp.searches))
+	for _, query := range exp.searches {
+		criteria, err := parseSearchCriteria(query.Criteria)
+		if err != nil {
+			exp.logger().WithField("query", query.Name).Error(err)
+			continue
+		}
+		results, err := imapClient.Search(criteria)
+		if err != nil {
+			exp.logger().WithField("query", query.Name).Error(err)
+			continue
+		}
+		state.searchResults[query.Name] = float64(len(results))
+	}
+
+	if exp.quota {
+		state.quota, err = fetchQuota(imapClient, exp.mailbox)
+		if err != nil {
+			exp.logger().Error(err)
+		}
+	}
 
 	return state
 }
 
 func (exp *Exporter) Collect(ch chan<- prometheus.Metric) {
-	state := exp.queryImapServer()
+	var state ImapState
+	if exp.persistent {
+		state = acquireSession(exp).snapshot()
+	} else {
+		state = exp.queryImapServer(context.Background())
+	}
+	exp.collectState(ch, state)
+}
+
+// collectState emits metrics for an already-fetched ImapState without
+// touching the IMAP server itself. It's split out of Collect so /probe can
+// reuse the exact metric set from a single queryImapServer call instead of
+// registering exp directly and triggering a second, deadline-less one via
+// Gather.
+func (exp *Exporter) collectState(ch chan<- prometheus.Metric, state ImapState) {
 	exp.messagesCount.Set(state.messagesCount)
 	ch <- exp.messagesCount
 	ch <- prometheus.MustNewConstMetric(exp.up, prometheus.GaugeValue, float64(state.up))
+	ch <- prometheus.MustNewConstMetric(exp.unseenCount, prometheus.GaugeValue, state.unseenCount)
+	ch <- prometheus.MustNewConstMetric(exp.recentCount, prometheus.GaugeValue, state.recentCount)
+	ch <- prometheus.MustNewConstMetric(exp.uidNext, prometheus.GaugeValue, state.uidNext)
+	ch <- prometheus.MustNewConstMetric(exp.uidValidity, prometheus.GaugeValue, state.uidValidity)
+	for query, count := range state.searchResults {
+		ch <- prometheus.MustNewConstMetric(exp.searchResults, prometheus.GaugeValue, count, query)
+	}
+	if state.quota != nil {
+		ch <- prometheus.MustNewConstMetric(exp.quotaUsedBytes, prometheus.GaugeValue, state.quota.usedBytes)
+		ch <- prometheus.MustNewConstMetric(exp.quotaLimitBytes, prometheus.GaugeValue, state.quota.limitBytes)
+		ch <- prometheus.MustNewConstMetric(exp.quotaUsedMessages, prometheus.GaugeValue, state.quota.usedMessages)
+	}
+	exp.lastError.Collect(ch)
 }
 
 var (
+	configFile = flag.String("config.file", os.Getenv("CONFIG_FILE"), "Path to the exporter configuration file (accounts, mailboxes, TLS, auth)")
+
+	// Legacy single-target flags, kept for backwards compatibility with
+	// deployments that don't use a config file yet.
 	imapServer   = flag.String("imap.server", os.Getenv("IMAP_SERVER"), "IMAP server to query")
 	imapUsername = flag.String("imap.username", os.Getenv("IMAP_USERNAME"), "IMAP username for login")
 	imapPassword = flag.String("imap.password", os.Getenv("IMAP_PASSWORD"), "IMAP password for login")
@@ -112,24 +340,59 @@ var (
 
 	listenAddress   = flag.String("listen.address", os.Getenv("LISTEN_ADDRESS"), "")
 	metricsEndpoint = flag.String("metrics.endpoint", os.Getenv("METRICS_ENDPOINT"), "")
+
+	logFormat = flag.String("log.format", os.Getenv("LOG_FORMAT"), "Log format: text or json")
+	logLevel  = flag.String("log.level", os.Getenv("LOG_LEVEL"), "Log level: debug, info, warn, error, fatal")
 )
 
-func main() {
-	flag.Parse()
+// loadConfig returns the exporter configuration, either from --config.file
+// or, failing that, synthesized from the legacy single-target flags.
+func loadConfig() (*Config, error) {
+	if *configFile != "" {
+		return LoadConfig(*configFile)
+	}
 
 	if *imapServer == "" {
-		logrus.Fatal("Missing IMAP server configuration")
+		exporterLog.Fatal("Missing IMAP server configuration")
 	}
 	if *imapUsername == "" {
-		logrus.Fatal("Missing IMAP username configuration")
+		exporterLog.Fatal("Missing IMAP username configuration")
 	}
 	if *imapPassword == "" {
-		logrus.Fatal("Missing IMAP password configuration")
+		exporterLog.Fatal("Missing IMAP password configuration")
 	}
-
 	if *imapMailbox == "" {
 		*imapMailbox = "INBOX"
 	}
+
+	return &Config{
+		Accounts: []AccountConfig{
+			{
+				Name:      *imapUsername,
+				Server:    *imapServer,
+				Username:  *imapUsername,
+				Password:  *imapPassword,
+				Mailboxes: []TargetConfig{{Mailbox: *imapMailbox}},
+			},
+		},
+	}, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if *logLevel == "" {
+		*logLevel = "info"
+	}
+	if err := initLogger(*logFormat, *logLevel); err != nil {
+		exporterLog.Fatal(err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		exporterLog.Fatal(err)
+	}
+
 	if *listenAddress == "" {
 		*listenAddress = ":9117"
 	}
@@ -137,21 +400,25 @@ func main() {
 		*metricsEndpoint = "/metrics"
 	}
 
-	exporter := NewExporter(*imapServer, *imapUsername, *imapPassword, *imapMailbox)
-	prometheus.MustRegister(exporter)
+	for _, acc := range cfg.Accounts {
+		for _, target := range acc.Mailboxes {
+			prometheus.MustRegister(NewExporter(acc, target))
+		}
+	}
 
 	http.Handle(*metricsEndpoint, promhttp.Handler())
+	http.HandleFunc("/probe", probeHandler(cfg))
 	http.HandleFunc("/", func(writer http.ResponseWriter, req *http.Request) {
 		_, err := writer.Write([]byte("<html><head><title>IMAP mailbox exporter</title></head><body><h1>IMAP mailbox exporter</h1></body></html>"))
 		if err != nil {
-			logrus.Error(err)
+			exporterLog.Error(err)
 		}
 	})
 
-	logrus.Infof("Exporter listening on %s", *listenAddress)
+	exporterLog.Infof("Exporter listening on %s", *listenAddress)
 
-	err := http.ListenAndServe(*listenAddress, nil)
+	err = http.ListenAndServe(*listenAddress, nil)
 	if err != nil {
-		logrus.Error(err)
+		exporterLog.Error(err)
 	}
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// initLogger configures the process-wide logrus logger shared by every
+// package-scoped logger declared throughout this codebase (exporterLog,
+// poolLog, ...), so --log.format/--log.level apply everywhere uniformly.
+func initLogger(format, level string) error {
+	switch format {
+	case "", "text":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unsupported log format %q, want text or json", format)
+	}
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("parsing log level: %w", err)
+	}
+	logrus.SetLevel(lvl)
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// NotifyConfig publishes a notification to an ntfy topic or a generic
+// webhook whenever a watched mailbox's message count goes up (IMAP
+// EXISTS). Title and Message are Go templates rendered against
+// notifyEvent.
+type NotifyConfig struct {
+	TopicURL string `yaml:"topic_url"`
+	Priority string `yaml:"priority"`
+	Title    string `yaml:"title"`
+	Message  string `yaml:"message"`
+}
+
+// notifyEvent is the data available to the Title/Message templates.
+type notifyEvent struct {
+	Mailbox string
+	From    string
+	Subject string
+}
+
+const (
+	defaultNotifyTitle   = "New mail in {{.Mailbox}}"
+	defaultNotifyMessage = "{{.From}}: {{.Subject}}"
+)
+
+// fetchNotifyEvent reads the ENVELOPE of the mailbox's newest message
+// (sequence number newCount) so a notification can be rendered from its
+// From/Subject. It must be called on the session's own goroutine since
+// imapClient is not safe for concurrent use.
+func fetchNotifyEvent(imapClient *client.Client, mailbox string, newCount uint32) (notifyEvent, error) {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(newCount)
+
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- imapClient.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope}, messages)
+	}()
+
+	var msg *imap.Message
+	for m := range messages {
+		msg = m
+	}
+	if err := <-done; err != nil {
+		return notifyEvent{}, fmt.Errorf("fetching envelope: %w", err)
+	}
+	if msg == nil || msg.Envelope == nil {
+		return notifyEvent{}, fmt.Errorf("no envelope returned for message %d", newCount)
+	}
+
+	from := ""
+	if len(msg.Envelope.From) > 0 {
+		from = msg.Envelope.From[0].Address()
+	}
+
+	return notifyEvent{
+		Mailbox: mailbox,
+		From:    from,
+		Subject: msg.Envelope.Subject,
+	}, nil
+}
+
+// sendNotification renders cfg's title/message templates against event and
+// POSTs the result to cfg.TopicURL. It touches no IMAP state, so it's safe
+// to call from a separate goroutine.
+func sendNotification(cfg NotifyConfig, event notifyEvent) error {
+	title, err := renderNotifyTemplate("title", firstNonEmpty(cfg.Title, defaultNotifyTitle), event)
+	if err != nil {
+		return err
+	}
+	message, err := renderNotifyTemplate("message", firstNonEmpty(cfg.Message, defaultNotifyMessage), event)
+	if err != nil {
+		return err
+	}
+
+	// ntfy takes the notification body as the plain-text request body,
+	// with title/priority as headers; a generic webhook receiver can
+	// simply ignore the headers it doesn't care about.
+	req, err := http.NewRequest(http.MethodPost, cfg.TopicURL, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Title", title)
+	if cfg.Priority != "" {
+		req.Header.Set("X-Priority", cfg.Priority)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notifier: unexpected status %s from %s", resp.Status, cfg.TopicURL)
+	}
+	return nil
+}
+
+func renderNotifyTemplate(name, text string, event notifyEvent) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", fmt.Errorf("rendering %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
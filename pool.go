@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	idle "github.com/emersion/go-imap-idle"
+	"github.com/emersion/go-imap/client"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff = 2 * time.Minute
+	idleFallbackPoll    = 30 * time.Second
+)
+
+// poolLog is the package-scoped logger for this file; every entry carries
+// pkg="pool".
+var poolLog = logrus.WithField("pkg", "pool")
+
+// sessionKey identifies a persistent IMAP session, shared by every
+// Exporter that scrapes the same mailbox.
+type sessionKey struct {
+	server   string
+	username string
+	mailbox  string
+}
+
+// session keeps a single IMAP connection alive across scrapes, refreshing
+// its cached ImapState in the background via IDLE (falling back to
+// periodic NOOP/STATUS polling) instead of paying login latency on every
+// Prometheus scrape. go-imap's client.Client is not goroutine-safe, so it
+// is only driven from the session's own run goroutine, which always waits
+// for the IDLE and FETCH helper goroutines it starts before issuing the
+// next command; Collect only reads the mutex-guarded snapshot below. connectAndWatch always stops a
+// live IDLE (DONE, then waits for the tagged response) before issuing any
+// other command, so commands and IDLE never race on the connection and no
+// separate lock around imapClient is needed.
+type session struct {
+	key sessionKey
+	exp *Exporter
+
+	mu    sync.Mutex
+	state ImapState
+}
+
+// pool is the process-wide registry of persistent sessions, keyed so that
+// accounts/mailboxes sharing a (server, username, mailbox) reuse one
+// connection.
+var pool = struct {
+	mu       sync.Mutex
+	sessions map[sessionKey]*session
+}{sessions: make(map[sessionKey]*session)}
+
+// acquireSession returns the persistent session for exp, starting its
+// background connect/IDLE loop the first time it's requested.
+func acquireSession(exp *Exporter) *session {
+	key := sessionKey{server: exp.server, username: exp.username, mailbox: exp.mailbox}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if s, ok := pool.sessions[key]; ok {
+		return s
+	}
+
+	s := &session{key: key, exp: exp}
+	pool.sessions[key] = s
+	go s.run()
+	return s
+}
+
+// snapshot returns the most recently cached ImapState for this session.
+func (s *session) snapshot() ImapState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// logger returns a logrus entry pre-populated with this session's
+// identity, matching the fields Exporter.logger attaches.
+func (s *session) logger() *logrus.Entry {
+	return poolLog.WithFields(logrus.Fields{
+		"account": s.exp.account,
+		"server":  s.key.server,
+		"mailbox": s.key.mailbox,
+	})
+}
+
+// run owns the session's connection for its entire lifetime: connect,
+// IDLE (or poll) until disconnected, then reconnect with exponential
+// backoff. An attempt that came up (a refresh succeeded) and lasted at
+// least minReconnectBackoff, counted from the dial, counts as healthy and
+// resets backoff to its floor, so a long-lived session that drops once
+// doesn't inherit a maxed-out backoff left behind by an earlier, unrelated
+// run of failures. Between attempts the cached state reports up=0.
+func (s *session) run() {
+	backoff := minReconnectBackoff
+	for {
+		start := time.Now()
+		if err := s.connectAndWatch(); err != nil {
+			s.logger().Error(err)
+		}
+
+		s.mu.Lock()
+		wasUp := s.state.up == 1
+		s.state.up = 0
+		s.mu.Unlock()
+
+		if wasUp && time.Since(start) >= minReconnectBackoff {
+			backoff = minReconnectBackoff
+		} else {
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+		}
+
+		time.Sleep(backoff)
+	}
+}
+
+// connectAndWatch dials, logs in, selects the mailbox, refreshes the
+// cached state once, then blocks watching for unilateral server updates
+// until the connection is lost or a step fails. It always returns a
+// non-nil error; run uses whether the connection came up and how long it
+// lasted, not this return value, to decide whether to reset backoff.
+func (s *session) connectAndWatch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	imapClient, err := s.exp.dial(ctx)
+	if err != nil {
+		s.exp.lastError.WithLabelValues("dial").Inc()
+		return err
+	}
+	defer imapClient.Logout()
+
+	saslClient, err := s.exp.auth.saslClient(s.exp.username, s.exp.password)
+	if err != nil {
+		s.exp.lastError.WithLabelValues("login").Inc()
+		return err
+	}
+	loginStart := time.Now()
+	if saslClient != nil {
+		err = imapClient.Authenticate(saslClient)
+	} else {
+		err = imapClient.Login(s.exp.username, s.exp.password)
+	}
+	if err != nil {
+		s.exp.lastError.WithLabelValues("login").Inc()
+		return err
+	}
+	s.logger().WithField("duration_ms", time.Since(loginStart).Milliseconds()).Debug("logged in")
+
+	updates := make(chan client.Update, 8)
+	imapClient.Updates = updates
+
+	if _, err := imapClient.Select(s.exp.mailbox, true); err != nil {
+		s.exp.lastError.WithLabelValues("select").Inc()
+		return err
+	}
+	s.refresh(imapClient)
+
+	idleClient := idle.NewClient(imapClient)
+	supportsIdle, err := imapClient.Support("IDLE")
+	if err != nil {
+		supportsIdle = false
+	}
+
+	if !supportsIdle {
+		return s.pollUntilDisconnected(imapClient)
+	}
+
+	for {
+		stop := make(chan struct{})
+		idleErr := make(chan error, 1)
+		go func() { idleErr <- idleClient.IdleWithFallback(stop, 0) }()
+
+		if err := s.waitForIdleEvent(updates, idleErr); err != nil {
+			return err
+		}
+
+		// RFC 2177: the server is scanning the stream for DONE while IDLE
+		// is outstanding, so send it and wait for the idle command to
+		// actually return before issuing Status/Search/Fetch below.
+		close(stop)
+		if err := <-idleErr; err != nil {
+			return err
+		}
+
+		s.refresh(imapClient)
+	}
+}
+
+// waitForIdleEvent blocks until a mailbox update worth refreshing for
+// arrives, the belt-and-braces poll interval elapses, or the outstanding
+// IDLE command itself ends (e.g. the connection dropped).
+func (s *session) waitForIdleEvent(updates <-chan client.Update, idleErr <-chan error) error {
+	for {
+		select {
+		case update := <-updates:
+			switch update.(type) {
+			case *client.MailboxUpdate, *client.ExpungeUpdate:
+				return nil
+			}
+		case err := <-idleErr:
+			return err
+		case <-time.After(idleFallbackPoll):
+			return nil
+		}
+	}
+}
+
+// pollUntilDisconnected is used when the server doesn't advertise IDLE: it
+// periodically issues NOOP/STATUS instead of holding a long-lived IDLE
+// command open.
+func (s *session) pollUntilDisconnected(imapClient *client.Client) error {
+	for {
+		time.Sleep(idleFallbackPoll)
+		if err := imapClient.Noop(); err != nil {
+			return err
+		}
+		s.refresh(imapClient)
+	}
+}
+
+// notifyNewMessages fetches the newest message's envelope on the session's
+// own goroutine, then publishes the rendered notification in the
+// background so a slow or unreachable ntfy/webhook endpoint never stalls
+// the IDLE loop. It's only ever called from refresh, which connectAndWatch
+// only invokes once IDLE has been stopped and its tagged response read, so
+// the Fetch here never races an outstanding IDLE command.
+func (s *session) notifyNewMessages(imapClient *client.Client, newCount uint32) {
+	event, err := fetchNotifyEvent(imapClient, s.exp.mailbox, newCount)
+	if err != nil {
+		s.logger().Error(err)
+		return
+	}
+
+	cfg := *s.exp.notify
+	go func() {
+		if err := sendNotification(cfg, event); err != nil {
+			s.logger().Error(err)
+		}
+	}()
+}
+
+// refresh re-runs the cheap parts of queryImapServer (STATUS, UNSEEN
+// search, configured searches, quota) against an already-selected mailbox
+// and updates the cached state.
+func (s *session) refresh(imapClient *client.Client) {
+	previous := s.snapshot()
+
+	status, err := imapClient.Status(s.exp.mailbox, []imap.StatusItem{
+		imap.StatusMessages, imap.StatusRecent, imap.StatusUidNext, imap.StatusUidValidity,
+	})
+	if err != nil {
+		s.logger().Error(err)
+		return
+	}
+
+	state := ImapState{
+		up:            1,
+		messagesCount: float64(status.Messages),
+		recentCount:   float64(status.Recent),
+		uidNext:       float64(status.UidNext),
+		uidValidity:   float64(status.UidValidity),
+	}
+
+	if s.exp.notify != nil && previous.up == 1 && status.Messages > uint32(previous.messagesCount) {
+		s.notifyNewMessages(imapClient, status.Messages)
+	}
+
+	if unseen, err := imapClient.Search(&imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}); err != nil {
+		s.logger().Error(err)
+	} else {
+		state.unseenCount = float64(len(unseen))
+	}
+
+	state.searchResults = make(map[string]float64, len(s.exp.searches))
+	for _, query := range s.exp.searches {
+		criteria, err := parseSearchCriteria(query.Criteria)
+		if err != nil {
+			s.logger().Error(err)
+			continue
+		}
+		results, err := imapClient.Search(criteria)
+		if err != nil {
+			s.logger().Error(err)
+			continue
+		}
+		state.searchResults[query.Name] = float64(len(results))
+	}
+
+	if s.exp.quota {
+		if q, err := fetchQuota(imapClient, s.exp.mailbox); err != nil {
+			s.logger().Error(err)
+		} else {
+			state.quota = q
+		}
+	}
+
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// defaultProbeTimeout is used when Prometheus doesn't advertise a scrape
+// timeout via the X-Prometheus-Scrape-Timeout-Seconds header.
+const defaultProbeTimeout = 10 * time.Second
+
+// probeCollector exposes exp's usual metric set for a single, already-
+// fetched ImapState. Registering exp itself would make Gather call
+// exp.Collect, which re-runs queryImapServer a second time with no
+// deadline; this wrapper reuses the one query the handler already paid for.
+type probeCollector struct {
+	exp   *Exporter
+	state ImapState
+}
+
+func (p probeCollector) Describe(ch chan<- *prometheus.Desc) { p.exp.Describe(ch) }
+
+func (p probeCollector) Collect(ch chan<- prometheus.Metric) { p.exp.collectState(ch, p.state) }
+
+// probeHandler implements a blackbox_exporter style multi-target probe:
+// GET /probe?target=host:port&mailbox=INBOX&module=default
+//
+// It builds a throwaway Exporter and Registry per request and runs a
+// single IMAP session, instead of requiring one exporter process per
+// mailbox.
+func probeHandler(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		target := params.Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		mailbox := params.Get("mailbox")
+		if mailbox == "" {
+			mailbox = "INBOX"
+		}
+
+		moduleName := params.Get("module")
+		if moduleName == "" {
+			moduleName = "default"
+		}
+		module, ok := cfg.Modules[moduleName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), scrapeTimeout(r))
+		defer cancel()
+
+		acc := AccountConfig{
+			Name:     moduleName,
+			Server:   target,
+			Username: module.Username,
+			Password: module.Password,
+			TLS:      module.TLS,
+			Auth:     module.Auth,
+			Quota:    module.Quota,
+		}
+		exp := NewExporter(acc, TargetConfig{Mailbox: mailbox, Searches: module.Searches})
+
+		probeStart := time.Now()
+		state := exp.queryImapServer(ctx)
+		probeDuration := time.Since(probeStart)
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(probeCollector{exp: exp, state: state})
+		registry.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "imap_probe_success",
+				Help: "Whether the IMAP probe succeeded",
+			}, func() float64 { return float64(state.up) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "imap_probe_duration_seconds",
+				Help: "Total duration of the IMAP probe in seconds",
+			}, probeDuration.Seconds),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "imap_login_duration_seconds",
+				Help: "Duration of the IMAP login/authenticate step in seconds",
+			}, state.loginDuration.Seconds),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "imap_select_duration_seconds",
+				Help: "Duration of the IMAP SELECT step in seconds",
+			}, state.selectDuration.Seconds),
+		)
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
+// scrapeTimeout mirrors blackbox_exporter's convention of honouring the
+// X-Prometheus-Scrape-Timeout-Seconds header Prometheus sets on probes.
+func scrapeTimeout(r *http.Request) time.Duration {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return defaultProbeTimeout
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		return defaultProbeTimeout
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
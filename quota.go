@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/emersion/go-imap-quota"
+	"github.com/emersion/go-imap/client"
+)
+
+// quotaResult holds the RFC 2087 STORAGE and MESSAGE resources for a
+// mailbox's quota root, converted into the units Prometheus expects.
+type quotaResult struct {
+	usedBytes    float64
+	limitBytes   float64
+	usedMessages float64
+}
+
+// fetchQuota queries the QUOTA extension for mailbox's quota root and
+// returns nil, nil if the server doesn't support it.
+func fetchQuota(imapClient *client.Client, mailbox string) (*quotaResult, error) {
+	quotaClient := quota.NewClient(imapClient)
+
+	supported, err := quotaClient.SupportQuota()
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return nil, nil
+	}
+
+	statuses, err := quotaClient.GetQuotaRoot(mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &quotaResult{}
+	for _, status := range statuses {
+		if resource, ok := status.Resources["STORAGE"]; ok {
+			// RFC 2087 reports STORAGE in units of 1024 octets.
+			result.usedBytes += float64(resource[0]) * 1024
+			result.limitBytes += float64(resource[1]) * 1024
+		}
+		if resource, ok := status.Resources["MESSAGE"]; ok {
+			result.usedMessages += float64(resource[0])
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// parseSearchCriteria turns a small subset of IMAP SEARCH syntax into an
+// *imap.SearchCriteria. Supported tokens, space separated and ANDed
+// together: UNSEEN, SEEN, FLAGGED, ANSWERED, DELETED, DRAFT, RECENT,
+// "SINCE <n>d", "BEFORE <n>d", "LARGER <bytes>", "SMALLER <bytes>".
+func parseSearchCriteria(query string) (*imap.SearchCriteria, error) {
+	criteria := imap.NewSearchCriteria()
+
+	fields := strings.Fields(strings.ToUpper(query))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "UNSEEN":
+			criteria.WithoutFlags = append(criteria.WithoutFlags, imap.SeenFlag)
+		case "SEEN":
+			criteria.WithFlags = append(criteria.WithFlags, imap.SeenFlag)
+		case "FLAGGED":
+			criteria.WithFlags = append(criteria.WithFlags, imap.FlaggedFlag)
+		case "ANSWERED":
+			criteria.WithFlags = append(criteria.WithFlags, imap.AnsweredFlag)
+		case "DELETED":
+			criteria.WithFlags = append(criteria.WithFlags, imap.DeletedFlag)
+		case "DRAFT":
+			criteria.WithFlags = append(criteria.WithFlags, imap.DraftFlag)
+		case "RECENT":
+			criteria.WithFlags = append(criteria.WithFlags, imap.RecentFlag)
+		case "SINCE", "BEFORE":
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("%s requires a <n>d argument", fields[i])
+			}
+			i++
+			age, err := parseDaysAgo(fields[i])
+			if err != nil {
+				return nil, err
+			}
+			if fields[i-1] == "SINCE" {
+				criteria.Since = age
+			} else {
+				criteria.Before = age
+			}
+		case "LARGER", "SMALLER":
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("%s requires a byte size argument", fields[i])
+			}
+			i++
+			size, err := strconv.ParseUint(fields[i], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size %q: %w", fields[i], err)
+			}
+			if fields[i-1] == "LARGER" {
+				criteria.Larger = uint32(size)
+			} else {
+				criteria.Smaller = uint32(size)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported search token %q", fields[i])
+		}
+	}
+
+	return criteria, nil
+}
+
+// parseDaysAgo parses a relative age like "7d" into the absolute date that
+// many days before now, truncated to midnight as IMAP SEARCH expects.
+func parseDaysAgo(s string) (time.Time, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(strings.ToUpper(s), "D"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid relative date %q, expected <n>d: %w", s, err)
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -days), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestParseSearchCriteriaFlags(t *testing.T) {
+	tests := []struct {
+		query string
+		check func(*imap.SearchCriteria) bool
+	}{
+		{"UNSEEN", func(c *imap.SearchCriteria) bool { return contains(c.WithoutFlags, imap.SeenFlag) }},
+		{"seen", func(c *imap.SearchCriteria) bool { return contains(c.WithFlags, imap.SeenFlag) }},
+		{"FLAGGED", func(c *imap.SearchCriteria) bool { return contains(c.WithFlags, imap.FlaggedFlag) }},
+		{"ANSWERED", func(c *imap.SearchCriteria) bool { return contains(c.WithFlags, imap.AnsweredFlag) }},
+		{"DELETED", func(c *imap.SearchCriteria) bool { return contains(c.WithFlags, imap.DeletedFlag) }},
+		{"DRAFT", func(c *imap.SearchCriteria) bool { return contains(c.WithFlags, imap.DraftFlag) }},
+		{"RECENT", func(c *imap.SearchCriteria) bool { return contains(c.WithFlags, imap.RecentFlag) }},
+	}
+
+	for _, tt := range tests {
+		criteria, err := parseSearchCriteria(tt.query)
+		if err != nil {
+			t.Errorf("parseSearchCriteria(%q): unexpected error: %v", tt.query, err)
+			continue
+		}
+		if !tt.check(criteria) {
+			t.Errorf("parseSearchCriteria(%q): criteria missing expected flag: %+v", tt.query, criteria)
+		}
+	}
+}
+
+func TestParseSearchCriteriaSinceBefore(t *testing.T) {
+	criteria, err := parseSearchCriteria("SINCE 7d BEFORE 1d")
+	if err != nil {
+		t.Fatalf("parseSearchCriteria: %v", err)
+	}
+
+	wantSince, err := parseDaysAgo("7d")
+	if err != nil {
+		t.Fatalf("parseDaysAgo: %v", err)
+	}
+	wantBefore, err := parseDaysAgo("1d")
+	if err != nil {
+		t.Fatalf("parseDaysAgo: %v", err)
+	}
+
+	if !criteria.Since.Equal(wantSince) {
+		t.Errorf("Since = %v, want %v", criteria.Since, wantSince)
+	}
+	if !criteria.Before.Equal(wantBefore) {
+		t.Errorf("Before = %v, want %v", criteria.Before, wantBefore)
+	}
+}
+
+func TestParseSearchCriteriaLargerSmaller(t *testing.T) {
+	criteria, err := parseSearchCriteria("LARGER 1024 SMALLER 2048")
+	if err != nil {
+		t.Fatalf("parseSearchCriteria: %v", err)
+	}
+	if criteria.Larger != 1024 {
+		t.Errorf("Larger = %d, want 1024", criteria.Larger)
+	}
+	if criteria.Smaller != 2048 {
+		t.Errorf("Smaller = %d, want 2048", criteria.Smaller)
+	}
+}
+
+func TestParseSearchCriteriaErrors(t *testing.T) {
+	tests := []string{
+		"BOGUS",
+		"SINCE",
+		"LARGER",
+		"LARGER notanumber",
+		"SINCE notanumber",
+	}
+	for _, query := range tests {
+		if _, err := parseSearchCriteria(query); err == nil {
+			t.Errorf("parseSearchCriteria(%q): expected error, got nil", query)
+		}
+	}
+}
+
+func TestParseDaysAgo(t *testing.T) {
+	got, err := parseDaysAgo("3d")
+	if err != nil {
+		t.Fatalf("parseDaysAgo: %v", err)
+	}
+
+	now := time.Now()
+	want := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -3)
+	if !got.Equal(want) {
+		t.Errorf("parseDaysAgo(\"3d\") = %v, want %v", got, want)
+	}
+}
+
+func TestParseDaysAgoInvalid(t *testing.T) {
+	if _, err := parseDaysAgo("abc"); err == nil {
+		t.Error("parseDaysAgo(\"abc\"): expected error, got nil")
+	}
+}
+
+func contains(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}